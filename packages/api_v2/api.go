@@ -14,9 +14,10 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
 
-package apiv2
+package api_v2
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
@@ -25,8 +26,10 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/EGaaS/go-egaas-mvp/packages/cache"
 	"github.com/EGaaS/go-egaas-mvp/packages/config"
 	"github.com/EGaaS/go-egaas-mvp/packages/consts"
 	"github.com/EGaaS/go-egaas-mvp/packages/converter"
@@ -41,7 +44,7 @@ import (
 
 const (
 	jwtPrefix = "Bearer "
-	jwtExpire = 36000 // By default, seconds
+	jwtExpire = 36000 // Deprecated: access tokens are now short-lived, see accessTokenExpire in api_v2
 )
 
 type apiData struct {
@@ -77,6 +80,42 @@ var (
 	installed bool
 )
 
+// initSecurityOnce guards initSecurity, so it runs exactly once no
+// matter how many routes call DefaultHandler to register themselves.
+var initSecurityOnce sync.Once
+
+// initSecurity brings up the JWT key manager and the configured OIDC
+// providers. There is no single main.go init path shared by every
+// command this binary can run as, so it is triggered lazily by the
+// first request DefaultHandler serves instead.
+func initSecurity() {
+	if err := config.LoadFromEnv(); err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("loading config from environment")
+	}
+	if _, err := InitKeyManager(config.GetKeysDir()); err != nil {
+		log.WithFields(log.Fields{"type": consts.JWTError, "error": err}).Fatal("initializing jwt key manager")
+	}
+	if err := InitOIDCProviders(); err != nil {
+		log.WithFields(log.Fields{"type": consts.JWTError, "error": err}).Error("initializing oidc providers")
+	}
+	StartDeviceGrantReaper()
+}
+
+// defaultCache is the package-level Cache used by DefaultHandler and its
+// helpers to avoid refetching values that barely change between
+// requests, such as the system_states count and parsed JWT claims.
+var defaultCache cache.Cache = cache.NewMemoryStore()
+
+// FromContext returns the Cache to use for the current request. There is
+// currently a single process-wide cache, but handlers should go through
+// FromContext rather than defaultCache directly so a future per-request
+// or per-ecosystem cache can be swapped in without touching callers.
+func FromContext(ctx context.Context) cache.Cache {
+	return defaultCache
+}
+
+const systemStatesCountTTL = 10 * time.Second
+
 func errorAPI(w http.ResponseWriter, err interface{}, code int, params ...interface{}) error {
 	var (
 		msg, errCode, errParams string
@@ -160,6 +199,7 @@ func sendEmbeddedTx(txType int, userID int64, toSerialize interface{}) (*hashTx,
 
 // DefaultHandler is a common handle function for api requests
 func DefaultHandler(params map[string]int, handlers ...apiHandle) hr.Handle {
+	initSecurityOnce.Do(initSecurity)
 	return hr.Handle(func(w http.ResponseWriter, r *http.Request, ps hr.Params) {
 		var (
 			err  error
@@ -185,6 +225,9 @@ func DefaultHandler(params map[string]int, handlers ...apiHandle) hr.Handle {
 		token, err := jwtToken(r)
 		if err != nil {
 			requestLogger.WithFields(log.Fields{"type": consts.SessionError, "params": params, "error": err}).Error("starting session")
+			if isTokenExpired(err) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
 			errorAPI(w, err, http.StatusBadRequest)
 			return
 		}
@@ -251,11 +294,29 @@ func DefaultHandler(params map[string]int, handlers ...apiHandle) hr.Handle {
 	})
 }
 
-func checkEcosystem(w http.ResponseWriter, data *apiData, logger *log.Entry) (int64, error) {
+func getSystemStatesCount(ctx context.Context, logger *log.Entry) (int64, error) {
+	const cacheKey = `system_states:count`
+	c := FromContext(ctx)
+	if cached, err := c.Get(cacheKey); err == nil {
+		if count, ok := cached.(int64); ok {
+			return count, nil
+		}
+	}
+	count, err := model.GetNextID(`system_states`)
+	if err != nil {
+		return 0, err
+	}
+	if err := c.SetTTL(cacheKey, count, systemStatesCountTTL); err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Warning("caching system states count")
+	}
+	return count, nil
+}
+
+func checkEcosystem(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) (int64, error) {
 	state := data.state
 	if data.params[`ecosystem`].(int64) > 0 {
 		state = data.params[`ecosystem`].(int64)
-		count, err := model.GetNextID(`system_states`)
+		count, err := getSystemStatesCount(r.Context(), logger)
 		if err != nil {
 			logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("getting next id system states")
 			return 0, errorAPI(w, err, http.StatusBadRequest)
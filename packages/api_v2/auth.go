@@ -20,21 +20,29 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
-)
-
-var (
-	jwtSecret = "test" // To change !!!
+	log "github.com/sirupsen/logrus"
 )
 
 type JWTClaims struct {
 	UID    string `json:"uid"`
 	State  string `json:"state,omitempty"`
 	Wallet string `json:"wallet,omitempty"`
+	// Provider and Subject are set when the session came from an OIDC
+	// login rather than a wallet signature, so downstream handlers can
+	// tell the two identity origins apart.
+	Provider string `json:"provider,omitempty"`
+	Subject  string `json:"subject,omitempty"`
 	jwt.StandardClaims
 }
 
+// jwtTokenCacheKey prefixes the cache key used to memoize parsed claims,
+// so Invalidate(jwtTokenCacheKey) can drop them all at once if the key
+// manager's keys are ever rotated out from under a cached entry.
+const jwtTokenCacheKey = `jwt_token:`
+
 func jwtToken(r *http.Request) (*jwt.Token, error) {
 	auth := r.Header.Get(`Authorization`)
 	if len(auth) == 0 {
@@ -45,17 +53,49 @@ func jwtToken(r *http.Request) (*jwt.Token, error) {
 	} else {
 		return nil, fmt.Errorf(`wrong authorization value`)
 	}
-	return jwt.ParseWithClaims(auth, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	c := FromContext(r.Context())
+	if cached, err := c.Get(jwtTokenCacheKey + auth); err == nil {
+		if token, ok := cached.(*jwt.Token); ok {
+			return token, nil
+		}
+	}
+	token, err := jwt.ParseWithClaims(auth, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(jwtSecret), nil
+		kid, ok := token.Header["kid"].(string)
+		if !ok || len(kid) == 0 {
+			return nil, fmt.Errorf("token is missing kid header")
+		}
+		if keyManager == nil {
+			return nil, fmt.Errorf("jwt key manager is not initialized")
+		}
+		pub := keyManager.verifyKey(kid)
+		if pub == nil {
+			return nil, fmt.Errorf("unknown signing key %s", kid)
+		}
+		return pub, nil
 	})
+	if err != nil {
+		return token, err
+	}
+	if claims, ok := token.Claims.(*JWTClaims); ok && claims.ExpiresAt > time.Now().Unix() {
+		ttl := time.Duration(claims.ExpiresAt-time.Now().Unix()) * time.Second
+		if err := c.SetTTL(jwtTokenCacheKey+auth, token, ttl); err != nil {
+			log.WithFields(log.Fields{"error": err}).Warning("caching parsed jwt claims")
+		}
+	}
+	return token, nil
 }
 
 func jwtSave(w http.ResponseWriter, claims JWTClaims) error {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(jwtSecret))
+	if keyManager == nil {
+		return errorAPI(w, `jwt key manager is not initialized`, http.StatusInternalServerError)
+	}
+	signing := keyManager.signingKey()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = signing.kid
+	signedToken, err := token.SignedString(signing.private)
 	if err != nil {
 		return errorAPI(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -63,14 +103,14 @@ func jwtSave(w http.ResponseWriter, claims JWTClaims) error {
 	return nil
 }
 
-func authWallet(w http.ResponseWriter, r *http.Request, data *apiData) error {
+func authWallet(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
 	if data.wallet == 0 {
 		return errorAPI(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 	}
 	return nil
 }
 
-func authState(w http.ResponseWriter, r *http.Request, data *apiData) error {
+func authState(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
 	if data.wallet == 0 || data.state <= 1 {
 		return errorAPI(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
 	}
@@ -0,0 +1,228 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/model"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	deviceCodeBytes       = 43
+	deviceCodeExpire      = 10 * 60 // 10 minutes, seconds
+	deviceDefaultInterval = 5       // seconds
+	deviceSlowDownStep    = 5       // seconds
+	deviceReapInterval    = time.Minute
+	userCodeAlphabet      = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O/1/I
+)
+
+// deviceCodeResponse is returned by POST /api/v2/device/code.
+type deviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// deviceStore abstracts device_grants persistence behind the polling
+// state machine below. modelDeviceStore is the live DB-backed
+// implementation installed by default; withFakeDeviceStore swaps in an
+// in-memory one for tests.
+type deviceStore interface {
+	Create(deviceCode, userCode string, interval int, expiresAt int64) error
+	Get(deviceCode string) (*model.DeviceGrant, error)
+	GetByUserCode(userCode string) (*model.DeviceGrant, error)
+	UpdatePoll(deviceCode string, polledAt int64, interval int) error
+	Approve(deviceCode string, wallet, state int64) error
+	Delete(deviceCode string) error
+}
+
+type modelDeviceStore struct{}
+
+func (modelDeviceStore) Create(deviceCode, userCode string, interval int, expiresAt int64) error {
+	return model.CreateDeviceGrant(deviceCode, userCode, interval, expiresAt)
+}
+
+func (modelDeviceStore) Get(deviceCode string) (*model.DeviceGrant, error) {
+	return model.GetDeviceGrant(deviceCode)
+}
+
+func (modelDeviceStore) GetByUserCode(userCode string) (*model.DeviceGrant, error) {
+	return model.GetDeviceGrantByUserCode(userCode)
+}
+
+func (modelDeviceStore) UpdatePoll(deviceCode string, polledAt int64, interval int) error {
+	return model.UpdateDeviceGrantPoll(deviceCode, polledAt, interval)
+}
+
+func (modelDeviceStore) Approve(deviceCode string, wallet, state int64) error {
+	return model.ApproveDeviceGrant(deviceCode, wallet, state)
+}
+
+func (modelDeviceStore) Delete(deviceCode string) error {
+	return model.DeleteDeviceGrant(deviceCode)
+}
+
+var deviceStoreImpl deviceStore = modelDeviceStore{}
+
+func randomDeviceCode() (string, error) {
+	buf := make([]byte, deviceCodeBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return ``, err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func randomUserCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return ``, err
+	}
+	code := make([]byte, 8)
+	for i, b := range buf {
+		code[i] = userCodeAlphabet[int(b)%len(userCodeAlphabet)]
+	}
+	return fmt.Sprintf("%s-%s", code[:4], code[4:]), nil
+}
+
+// deviceCodeHandler serves POST /api/v2/device/code. It is the first
+// step of the device authorization grant: a CLI wallet or kiosk without
+// a browser calls this to get a code pair, then polls deviceTokenHandler
+// while the user approves the pairing at VerificationURI.
+func deviceCodeHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	deviceCode, err := randomDeviceCode()
+	if err != nil {
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	userCode, err := randomUserCode()
+	if err != nil {
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	verificationURI := data.params[`verification_uri`]
+	if verificationURI == nil || len(verificationURI.(string)) == 0 {
+		verificationURI = "/api/v2/device/verify"
+	}
+	if err := deviceStoreImpl.Create(deviceCode, userCode, deviceDefaultInterval,
+		time.Now().Unix()+deviceCodeExpire); err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("creating device grant")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	data.result = &deviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI.(string),
+		VerificationURIComplete: fmt.Sprintf("%s?user_code=%s", verificationURI, userCode),
+		ExpiresIn:               deviceCodeExpire,
+		Interval:                deviceDefaultInterval,
+	}
+	return nil
+}
+
+// deviceTokenHandler serves POST /api/v2/device/token, polled by the
+// client until the user approves or denies the pairing, or it expires.
+func deviceTokenHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	deviceCode, _ := data.params[`device_code`].(string)
+	if len(deviceCode) == 0 {
+		return errorAPI(w, `E_UNDEFINEVAL`, http.StatusBadRequest, `device_code`)
+	}
+	grant, err := deviceStoreImpl.Get(deviceCode)
+	if err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("getting device grant")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	if grant == nil {
+		return errorAPI(w, `expired_token`, http.StatusBadRequest)
+	}
+	now := time.Now().Unix()
+	if now > grant.ExpiresAt {
+		return errorAPI(w, `expired_token`, http.StatusBadRequest)
+	}
+	if now-grant.LastPolledAt < int64(grant.Interval) {
+		newInterval := grant.Interval + deviceSlowDownStep
+		if err := deviceStoreImpl.UpdatePoll(deviceCode, now, newInterval); err != nil {
+			logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("updating device grant poll interval")
+		}
+		return errorAPI(w, `slow_down`, http.StatusBadRequest)
+	}
+	if err := deviceStoreImpl.UpdatePoll(deviceCode, now, grant.Interval); err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("updating device grant poll time")
+	}
+	switch grant.Status {
+	case model.DeviceGrantDenied:
+		return errorAPI(w, `access_denied`, http.StatusBadRequest)
+	case model.DeviceGrantPending:
+		return errorAPI(w, `authorization_pending`, http.StatusBadRequest)
+	case model.DeviceGrantApproved:
+		pair, err := issueTokenPair(w, fmt.Sprintf("%d", grant.Wallet), fmt.Sprintf("%d", grant.State))
+		if err != nil {
+			return err
+		}
+		if err := deviceStoreImpl.Delete(deviceCode); err != nil {
+			logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("deleting redeemed device grant")
+		}
+		data.result = pair
+		return nil
+	default:
+		return errorAPI(w, `authorization_pending`, http.StatusBadRequest)
+	}
+}
+
+// deviceVerifyHandler serves GET /api/v2/device/verify?user_code=...
+// An already-logged-in wallet holder (authWallet has already run) hits
+// this to confirm the pairing; the pending device record is marked
+// approved and bound to their wallet+state.
+func deviceVerifyHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	userCode, _ := data.params[`user_code`].(string)
+	if len(userCode) == 0 {
+		return errorAPI(w, `E_UNDEFINEVAL`, http.StatusBadRequest, `user_code`)
+	}
+	grant, err := deviceStoreImpl.GetByUserCode(userCode)
+	if err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("getting device grant by user code")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	if grant == nil || time.Now().Unix() > grant.ExpiresAt {
+		return errorAPI(w, `E_DEVICECODE`, http.StatusBadRequest, userCode)
+	}
+	if err := deviceStoreImpl.Approve(grant.DeviceCode, data.wallet, data.state); err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("approving device grant")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	data.result = fmt.Sprintf(`device paired`)
+	return nil
+}
+
+// StartDeviceGrantReaper reaps expired device grant rows on a ticker, so
+// POST /api/v2/device/code keeps appending to a bounded table.
+func StartDeviceGrantReaper() {
+	go func() {
+		for range time.Tick(deviceReapInterval) {
+			if err := model.DeleteExpiredDeviceGrants(time.Now().Unix()); err != nil {
+				log.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("reaping expired device grants")
+			}
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/model"
+)
+
+// fakeDeviceStore is an in-memory deviceStore used so the device-grant
+// polling state machine in device.go can be tested without a live DB.
+type fakeDeviceStore struct {
+	byDeviceCode map[string]*model.DeviceGrant
+}
+
+func newFakeDeviceStore() *fakeDeviceStore {
+	return &fakeDeviceStore{byDeviceCode: make(map[string]*model.DeviceGrant)}
+}
+
+func (f *fakeDeviceStore) Create(deviceCode, userCode string, interval int, expiresAt int64) error {
+	f.byDeviceCode[deviceCode] = &model.DeviceGrant{DeviceCode: deviceCode, UserCode: userCode,
+		Status: model.DeviceGrantPending, Interval: interval, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (f *fakeDeviceStore) Get(deviceCode string) (*model.DeviceGrant, error) {
+	return f.byDeviceCode[deviceCode], nil
+}
+
+func (f *fakeDeviceStore) GetByUserCode(userCode string) (*model.DeviceGrant, error) {
+	for _, g := range f.byDeviceCode {
+		if g.UserCode == userCode {
+			return g, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeDeviceStore) UpdatePoll(deviceCode string, polledAt int64, interval int) error {
+	g, ok := f.byDeviceCode[deviceCode]
+	if !ok {
+		return nil
+	}
+	g.LastPolledAt = polledAt
+	g.Interval = interval
+	return nil
+}
+
+func (f *fakeDeviceStore) Approve(deviceCode string, wallet, state int64) error {
+	g, ok := f.byDeviceCode[deviceCode]
+	if !ok {
+		return nil
+	}
+	g.Status = model.DeviceGrantApproved
+	g.Wallet = wallet
+	g.State = state
+	return nil
+}
+
+func (f *fakeDeviceStore) Delete(deviceCode string) error {
+	delete(f.byDeviceCode, deviceCode)
+	return nil
+}
+
+func withFakeDeviceStore(t *testing.T) *fakeDeviceStore {
+	t.Helper()
+	fake := newFakeDeviceStore()
+	original := deviceStoreImpl
+	deviceStoreImpl = fake
+	t.Cleanup(func() { deviceStoreImpl = original })
+	return fake
+}
+
+func TestDeviceTokenPendingUntilApproved(t *testing.T) {
+	fake := withFakeDeviceStore(t)
+	fake.byDeviceCode["dc1"] = &model.DeviceGrant{DeviceCode: "dc1", UserCode: "WDJB-MJHT",
+		Status: model.DeviceGrantPending, Interval: 5, ExpiresAt: time.Now().Unix() + 600}
+
+	data := &apiData{params: map[string]interface{}{`device_code`: "dc1"}}
+	err := deviceTokenHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v2/device/token", nil), data, testLogger())
+	if err == nil {
+		t.Fatal("expected authorization_pending before the grant is approved")
+	}
+}
+
+func TestDeviceTokenSlowDownWhenPolledTooFast(t *testing.T) {
+	fake := withFakeDeviceStore(t)
+	fake.byDeviceCode["dc1"] = &model.DeviceGrant{DeviceCode: "dc1", UserCode: "WDJB-MJHT",
+		Status: model.DeviceGrantPending, Interval: 5, LastPolledAt: time.Now().Unix(),
+		ExpiresAt: time.Now().Unix() + 600}
+
+	data := &apiData{params: map[string]interface{}{`device_code`: "dc1"}}
+	if err := deviceTokenHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v2/device/token", nil), data, testLogger()); err == nil {
+		t.Fatal("expected slow_down when polled faster than the interval")
+	}
+	if fake.byDeviceCode["dc1"].Interval != 10 {
+		t.Fatalf("expected interval to be bumped by deviceSlowDownStep, got %d", fake.byDeviceCode["dc1"].Interval)
+	}
+}
+
+func TestDeviceTokenExpired(t *testing.T) {
+	fake := withFakeDeviceStore(t)
+	fake.byDeviceCode["dc1"] = &model.DeviceGrant{DeviceCode: "dc1", UserCode: "WDJB-MJHT",
+		Status: model.DeviceGrantPending, Interval: 5, ExpiresAt: time.Now().Unix() - 1}
+
+	data := &apiData{params: map[string]interface{}{`device_code`: "dc1"}}
+	if err := deviceTokenHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v2/device/token", nil), data, testLogger()); err == nil {
+		t.Fatal("expected expired_token for a grant past its expires_at")
+	}
+}
+
+func TestDeviceTokenApprovedIssuesTokenPairAndDeletesGrant(t *testing.T) {
+	withTestKeyManager(t)
+	withFakeRefreshStore(t)
+	fake := withFakeDeviceStore(t)
+	fake.byDeviceCode["dc1"] = &model.DeviceGrant{DeviceCode: "dc1", UserCode: "WDJB-MJHT",
+		Status: model.DeviceGrantApproved, Wallet: 123, State: 1, Interval: 5,
+		ExpiresAt: time.Now().Unix() + 600}
+
+	data := &apiData{params: map[string]interface{}{`device_code`: "dc1"}}
+	if err := deviceTokenHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v2/device/token", nil), data, testLogger()); err != nil {
+		t.Fatalf("deviceTokenHandler: %v", err)
+	}
+	if _, ok := data.result.(*tokenPair); !ok {
+		t.Fatalf("expected a tokenPair result, got %#v", data.result)
+	}
+	if _, ok := fake.byDeviceCode["dc1"]; ok {
+		t.Fatal("expected the redeemed device grant to be deleted")
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	signingKeyBits = 2048
+	signingKeyFile = "jwt_signing.pem"
+	// keyRetention is how long a retained (rotated-out) key keeps
+	// verifying tokens that were signed before the rotation.
+	keyRetention = 24 * time.Hour * 7
+)
+
+// signingKey is one RSA keypair known to the KeyManager, identified by
+// its kid header value.
+type signingKey struct {
+	kid       string
+	private   *rsa.PrivateKey
+	notBefore time.Time
+	expiresAt time.Time
+}
+
+// KeyManager holds the current JWT signing key plus a ring of retained
+// public keys, so tokens signed before a rotation keep verifying until
+// they expire. It is safe for concurrent use.
+type KeyManager struct {
+	mu       sync.RWMutex
+	dir      string
+	current  *signingKey
+	retained []*signingKey
+}
+
+// keyManager is the package-level manager used by jwtSave/jwtToken. It
+// must be installed with InitKeyManager before the api_v2 handlers are
+// wired up.
+var keyManager *KeyManager
+
+// InitKeyManager loads the signing key from dir, generating and
+// persisting a new RSA keypair the first time it is called, installs it
+// as the package-level manager and starts the SIGHUP rotation trigger.
+func InitKeyManager(dir string) (*KeyManager, error) {
+	m := &KeyManager{dir: dir}
+	if err := m.loadOrGenerate(); err != nil {
+		return nil, err
+	}
+	keyManager = m
+	keyManager.watchRotateSignal()
+	return m, nil
+}
+
+func (m *KeyManager) keyPath() string {
+	return filepath.Join(m.dir, signingKeyFile)
+}
+
+func kidFor(pub *rsa.PublicKey) string {
+	sum := sha1.Sum(x509.MarshalPKCS1PublicKey(pub))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (m *KeyManager) loadOrGenerate() error {
+	raw, err := ioutil.ReadFile(m.keyPath())
+	if err == nil {
+		block, _ := pem.Decode(raw)
+		if block == nil {
+			return fmt.Errorf("jwt signing key %s is not valid PEM", m.keyPath())
+		}
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("parsing jwt signing key: %v", err)
+		}
+		m.current = &signingKey{kid: kidFor(&priv.PublicKey), private: priv, notBefore: time.Now()}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("reading jwt signing key %s: %v", m.keyPath(), err)
+	}
+	return m.generate()
+}
+
+func (m *KeyManager) generate() error {
+	priv, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return fmt.Errorf("generating jwt signing key: %v", err)
+	}
+	if err := os.MkdirAll(m.dir, 0700); err != nil {
+		return fmt.Errorf("creating jwt key dir %s: %v", m.dir, err)
+	}
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}
+	if err := ioutil.WriteFile(m.keyPath(), pem.EncodeToMemory(block), 0600); err != nil {
+		return fmt.Errorf("writing jwt signing key %s: %v", m.keyPath(), err)
+	}
+	m.current = &signingKey{kid: kidFor(&priv.PublicKey), private: priv, notBefore: time.Now()}
+	return nil
+}
+
+// Rotate generates a fresh signing key, moves the previous current key
+// into the retained ring and prunes any retained key past its
+// expiresAt.
+func (m *KeyManager) Rotate() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.current
+	if err := m.generate(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.expiresAt = time.Now().Add(keyRetention)
+		m.retained = append(m.retained, old)
+	}
+	pruned := m.retained[:0]
+	now := time.Now()
+	for _, k := range m.retained {
+		if now.Before(k.expiresAt) {
+			pruned = append(pruned, k)
+		}
+	}
+	m.retained = pruned
+	log.WithFields(log.Fields{"kid": m.current.kid}).Info("rotated jwt signing key")
+	// Cached claims are tied to the raw signed token string, so a stale
+	// entry stays harmless on its own, but dropping them here keeps the
+	// cache honest with what verifyKey can still actually verify.
+	if err := FromContext(context.Background()).Invalidate(jwtTokenCacheKey); err != nil {
+		log.WithFields(log.Fields{"error": err}).Warning("invalidating cached jwt claims after key rotation")
+	}
+	return nil
+}
+
+// watchRotateSignal triggers Rotate on SIGHUP, matching the way other
+// daemons in this project reload state without a restart.
+func (m *KeyManager) watchRotateSignal() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	go func() {
+		for range sigCh {
+			if err := m.Rotate(); err != nil {
+				log.WithFields(log.Fields{"error": err}).Error("rotating jwt signing key")
+			}
+		}
+	}()
+}
+
+func (m *KeyManager) signingKey() *signingKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.current
+}
+
+// verifyKey returns the public key registered under kid, looking first
+// at the current key and then the retained ring.
+func (m *KeyManager) verifyKey(kid string) *rsa.PublicKey {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.current != nil && m.current.kid == kid {
+		return &m.current.private.PublicKey
+	}
+	for _, k := range m.retained {
+		if k.kid == kid {
+			return &k.private.PublicKey
+		}
+	}
+	return nil
+}
+
+// jwk is a single entry of a JSON Web Key Set, RFC 7517.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+func b64BigInt(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func rsaToJWK(kid string, pub *rsa.PublicKey) jwk {
+	eBytes := []byte{byte(pub.E >> 16), byte(pub.E >> 8), byte(pub.E)}
+	for len(eBytes) > 1 && eBytes[0] == 0 {
+		eBytes = eBytes[1:]
+	}
+	return jwk{
+		Kid: kid,
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		N:   b64BigInt(pub.N.Bytes()),
+		E:   b64BigInt(eBytes),
+	}
+}
+
+// jwksDocument builds the JWKS document for the manager's current and
+// retained public keys.
+func (m *KeyManager) jwksDocument() jwks {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	doc := jwks{Keys: make([]jwk, 0, len(m.retained)+1)}
+	if m.current != nil {
+		doc.Keys = append(doc.Keys, rsaToJWK(m.current.kid, &m.current.private.PublicKey))
+	}
+	for _, k := range m.retained {
+		doc.Keys = append(doc.Keys, rsaToJWK(k.kid, &k.private.PublicKey))
+	}
+	return doc
+}
+
+// keysHandler serves GET /api/v2/keys, the JWKS document other nodes
+// and SPAs use to verify tokens issued by jwtSave without sharing a
+// secret.
+func keysHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	if keyManager == nil {
+		return errorAPI(w, `E_NOTINSTALLED`, http.StatusInternalServerError)
+	}
+	data.result = keyManager.jwksDocument()
+	return nil
+}
+
+// rotateKeyHandler serves the admin rotation trigger alongside SIGHUP,
+// for operators that would rather call an API than send a signal.
+func rotateKeyHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	if keyManager == nil {
+		return errorAPI(w, `E_NOTINSTALLED`, http.StatusInternalServerError)
+	}
+	if err := keyManager.Rotate(); err != nil {
+		logger.WithFields(log.Fields{"error": err}).Error("rotating jwt signing key via admin endpoint")
+		return errorAPI(w, err.Error(), http.StatusInternalServerError)
+	}
+	data.result = keyManager.jwksDocument()
+	return nil
+}
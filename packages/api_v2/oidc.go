@@ -0,0 +1,314 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/config"
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/model"
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	oidcStateCookie   = "oidc_state"
+	oidcNonceCookie   = "oidc_nonce"
+	oidcStateTTL      = 10 * time.Minute
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+)
+
+// oidcProvider is one entry of the OIDC provider list read from config,
+// plus what it discovers about itself on startup.
+type oidcProvider struct {
+	Name         string
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu                    sync.RWMutex
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+	keys                  jwks
+	keysFetchedAt         time.Time
+}
+
+type oidcDiscoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// oidcProviders holds the providers discovered at startup, keyed by the
+// name they appear under in the config and in the /oidc/{provider}/...
+// routes.
+var oidcProviders = map[string]*oidcProvider{}
+
+// InitOIDCProviders reads the configured OIDC providers and discovers
+// each of them, caching their JWKS for ID-token verification. It is
+// called once on startup, the same way InitKeyManager is.
+func InitOIDCProviders() error {
+	for _, cfg := range config.OIDCProviders() {
+		p := &oidcProvider{
+			Name:         cfg.Name,
+			IssuerURL:    strings.TrimRight(cfg.IssuerURL, "/"),
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		}
+		if err := p.discover(); err != nil {
+			return fmt.Errorf("discovering oidc provider %s: %v", p.Name, err)
+		}
+		oidcProviders[p.Name] = p
+	}
+	return nil
+}
+
+func (p *oidcProvider) discover() error {
+	resp, err := http.Get(p.IssuerURL + oidcDiscoveryPath)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var doc oidcDiscoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+	p.authorizationEndpoint = doc.AuthorizationEndpoint
+	p.tokenEndpoint = doc.TokenEndpoint
+	p.jwksURI = doc.JWKSURI
+	return p.refreshKeys()
+}
+
+func (p *oidcProvider) refreshKeys() error {
+	resp, err := http.Get(p.jwksURI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var keys jwks
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *oidcProvider) verifyKey(kid string) (*rsa.PublicKey, error) {
+	p.mu.RLock()
+	keys := p.keys
+	p.mu.RUnlock()
+	if pub := jwkToRSA(keys, kid); pub != nil {
+		return pub, nil
+	}
+	// The provider may have rotated its keys since our last fetch.
+	if err := p.refreshKeys(); err != nil {
+		return nil, err
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if pub := jwkToRSA(p.keys, kid); pub != nil {
+		return pub, nil
+	}
+	return nil, fmt.Errorf("unknown oidc signing key %s", kid)
+}
+
+func jwkToRSA(keys jwks, kid string) *rsa.PublicKey {
+	for _, k := range keys.Keys {
+		if k.Kid != kid || k.Kty != "RSA" {
+			continue
+		}
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		e := 0
+		for _, b := range eBytes {
+			e = e<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: e}
+	}
+	return nil
+}
+
+// oidcLoginHandler serves GET /api/v2/oidc/{provider}/login. It redirects
+// the browser to the provider's authorization endpoint, carrying a
+// signed state cookie that oidcCallbackHandler checks on return.
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	provider, ok := oidcProviders[fmt.Sprintf("%v", data.params[`provider`])]
+	if !ok {
+		return errorAPI(w, `E_OIDCPROVIDER`, http.StatusNotFound, data.params[`provider`])
+	}
+	state, err := generateOpaqueToken()
+	if err != nil {
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: state, HttpOnly: true,
+		Path: "/", Expires: time.Now().Add(oidcStateTTL)})
+	http.SetCookie(w, &http.Cookie{Name: oidcNonceCookie, Value: nonce, HttpOnly: true,
+		Path: "/", Expires: time.Now().Add(oidcStateTTL)})
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", provider.ClientID)
+	q.Set("redirect_uri", provider.RedirectURL)
+	q.Set("scope", strings.Join(provider.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	http.Redirect(w, r, provider.authorizationEndpoint+"?"+q.Encode(), http.StatusFound)
+	return nil
+}
+
+// oidcCallbackHandler serves GET /api/v2/oidc/{provider}/callback. It
+// exchanges the authorization code for tokens, verifies the ID token
+// against the provider's cached JWKS and hands back a native access
+// token plus a refresh token, the same pair a wallet-signature login
+// would issue via issueTokenPair.
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	provider, ok := oidcProviders[fmt.Sprintf("%v", data.params[`provider`])]
+	if !ok {
+		return errorAPI(w, `E_OIDCPROVIDER`, http.StatusNotFound, data.params[`provider`])
+	}
+	stateCookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || r.FormValue("state") != stateCookie.Value {
+		return errorAPI(w, `E_OIDCSTATE`, http.StatusBadRequest)
+	}
+	nonceCookie, err := r.Cookie(oidcNonceCookie)
+	if err != nil {
+		return errorAPI(w, `E_OIDCSTATE`, http.StatusBadRequest)
+	}
+	tokens, err := provider.exchangeCode(r.FormValue("code"))
+	if err != nil {
+		logger.WithFields(log.Fields{"provider": provider.Name, "error": err}).
+			Error("exchanging oidc authorization code")
+		return errorAPI(w, err, http.StatusBadGateway)
+	}
+	claims, err := provider.verifyIDToken(tokens.IDToken, nonceCookie.Value)
+	if err != nil {
+		return errorAPI(w, err, http.StatusUnauthorized)
+	}
+	wallet, state, err := model.GetOrCreateOIDCCitizen(provider.Name, claims.Subject)
+	if err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "provider": provider.Name, "error": err}).
+			Error("provisioning oidc citizen")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	jwtClaims := JWTClaims{
+		Wallet:   fmt.Sprintf("%d", wallet),
+		State:    fmt.Sprintf("%d", state),
+		Provider: provider.Name,
+		Subject:  claims.Subject,
+	}
+	jwtClaims.ExpiresAt = time.Now().Unix() + accessTokenExpire
+	if err := jwtSave(w, jwtClaims); err != nil {
+		return err
+	}
+	refresh, familyID, err := newRefreshFamily(wallet, state)
+	if err != nil {
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	logger.WithFields(log.Fields{"provider": provider.Name, "family": familyID}).Info("oidc login issued token pair")
+	data.result = &tokenPair{RefreshToken: refresh}
+	return nil
+}
+
+func (p *oidcProvider) exchangeCode(code string) (*oidcTokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	resp, err := http.PostForm(p.tokenEndpoint, form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc token endpoint returned %s", resp.Status)
+	}
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+// oidcIDClaims is what we read out of a provider's ID token.
+type oidcIDClaims struct {
+	jwt.StandardClaims
+	Nonce string `json:"nonce"`
+}
+
+func (p *oidcProvider) verifyIDToken(rawToken, expectNonce string) (*oidcIDClaims, error) {
+	claims := &oidcIDClaims{}
+	token, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("unexpected oidc signing method: %v", token.Header["alg"])
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.verifyKey(kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("oidc id token is not valid")
+	}
+	if claims.Issuer != p.IssuerURL {
+		return nil, fmt.Errorf("oidc id token has unexpected issuer %s", claims.Issuer)
+	}
+	if !claims.VerifyAudience(p.ClientID, true) {
+		return nil, fmt.Errorf("oidc id token has unexpected audience")
+	}
+	if claims.Nonce != expectNonce {
+		return nil, fmt.Errorf("oidc id token has unexpected nonce")
+	}
+	return claims, nil
+}
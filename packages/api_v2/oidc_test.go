@@ -0,0 +1,124 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// newTestOIDCProvider builds an oidcProvider whose JWKS is a single
+// self-signed RSA keypair, so verifyIDToken can be exercised without a
+// real OIDC server.
+func newTestOIDCProvider(t *testing.T) (*oidcProvider, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key: %v", err)
+	}
+	p := &oidcProvider{
+		Name:      "test",
+		IssuerURL: "https://issuer.example",
+		ClientID:  "test-client",
+		keys:      jwks{Keys: []jwk{rsaToJWK("test-kid", &key.PublicKey)}},
+	}
+	return p, key
+}
+
+func signTestIDToken(t *testing.T, key *rsa.PrivateKey, claims oidcIDClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test-kid"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("signing test id token: %v", err)
+	}
+	return signed
+}
+
+func baseTestClaims(p *oidcProvider) oidcIDClaims {
+	return oidcIDClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    p.IssuerURL,
+			Audience:  p.ClientID,
+			Subject:   "subject-1",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+		Nonce: "expected-nonce",
+	}
+}
+
+func TestVerifyIDTokenSucceeds(t *testing.T) {
+	p, key := newTestOIDCProvider(t)
+	signed := signTestIDToken(t, key, baseTestClaims(p))
+
+	claims, err := p.verifyIDToken(signed, "expected-nonce")
+	if err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+	if claims.Subject != "subject-1" {
+		t.Fatalf("unexpected subject: %s", claims.Subject)
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongIssuer(t *testing.T) {
+	p, key := newTestOIDCProvider(t)
+	claims := baseTestClaims(p)
+	claims.Issuer = "https://not-the-issuer.example"
+	signed := signTestIDToken(t, key, claims)
+
+	if _, err := p.verifyIDToken(signed, "expected-nonce"); err == nil {
+		t.Fatal("expected verifyIDToken to reject a mismatched issuer")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongAudience(t *testing.T) {
+	p, key := newTestOIDCProvider(t)
+	claims := baseTestClaims(p)
+	claims.Audience = "someone-elses-client-id"
+	signed := signTestIDToken(t, key, claims)
+
+	if _, err := p.verifyIDToken(signed, "expected-nonce"); err == nil {
+		t.Fatal("expected verifyIDToken to reject a mismatched audience")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongNonce(t *testing.T) {
+	p, key := newTestOIDCProvider(t)
+	signed := signTestIDToken(t, key, baseTestClaims(p))
+
+	if _, err := p.verifyIDToken(signed, "a-different-nonce"); err == nil {
+		t.Fatal("expected verifyIDToken to reject a mismatched nonce")
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongSigningKey(t *testing.T) {
+	p, _ := newTestOIDCProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating rsa key: %v", err)
+	}
+	signed := signTestIDToken(t, otherKey, baseTestClaims(p))
+
+	if _, err := p.verifyIDToken(signed, "expected-nonce"); err == nil {
+		t.Fatal("expected verifyIDToken to reject a token signed by an unknown key")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/consts"
+	"github.com/EGaaS/go-egaas-mvp/packages/converter"
+	"github.com/EGaaS/go-egaas-mvp/packages/model"
+	"github.com/dgrijalva/jwt-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// accessTokenExpire replaces the old 10h jwtExpire: access tokens
+	// are now short-lived and renewed via refreshHandler.
+	accessTokenExpire  = 10 * 60      // 10 minutes, seconds
+	refreshTokenExpire = 30 * 24 * 3600 // 30 days, seconds
+	refreshTokenBytes  = 32
+)
+
+// tokenPair is what a successful login, and a successful refresh,
+// return to the caller. The access token itself travels in the
+// Authorization response header, set by jwtSave; RefreshToken is the
+// only thing that needs to go in the JSON body.
+type tokenPair struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshStore abstracts refresh_tokens persistence behind the rotation
+// and reuse-detection logic below. modelRefreshStore is the live
+// DB-backed implementation installed by default; withFakeRefreshStore
+// swaps in an in-memory one for tests.
+type refreshStore interface {
+	Create(wallet, state int64, familyID, tokenHash string, expiresAt int64) error
+	Get(tokenHash string) (*model.RefreshToken, error)
+	RevokeFamily(familyID string) error
+	Rotate(familyID, oldHash, newHash string, expiresAt int64) error
+}
+
+type modelRefreshStore struct{}
+
+func (modelRefreshStore) Create(wallet, state int64, familyID, tokenHash string, expiresAt int64) error {
+	return model.CreateRefreshToken(wallet, state, familyID, tokenHash, expiresAt)
+}
+
+func (modelRefreshStore) Get(tokenHash string) (*model.RefreshToken, error) {
+	return model.GetRefreshToken(tokenHash)
+}
+
+func (modelRefreshStore) RevokeFamily(familyID string) error {
+	return model.RevokeRefreshFamily(familyID)
+}
+
+func (modelRefreshStore) Rotate(familyID, oldHash, newHash string, expiresAt int64) error {
+	return model.RotateRefreshToken(familyID, oldHash, newHash, expiresAt)
+}
+
+var refreshStoreImpl refreshStore = modelRefreshStore{}
+
+func generateOpaqueToken() (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return ``, err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshFamily stores a fresh refresh token family for wallet/state
+// and returns the opaque token to hand back to the caller, shared by
+// every login path that needs to start a new refresh token family
+// (issueTokenPair and oidcCallbackHandler).
+func newRefreshFamily(wallet, state int64) (refresh, familyID string, err error) {
+	refresh, err = generateOpaqueToken()
+	if err != nil {
+		return ``, ``, err
+	}
+	familyID, err = generateOpaqueToken()
+	if err != nil {
+		return ``, ``, err
+	}
+	if err := refreshStoreImpl.Create(wallet, state, familyID, hashToken(refresh),
+		time.Now().Unix()+refreshTokenExpire); err != nil {
+		return ``, ``, err
+	}
+	return refresh, familyID, nil
+}
+
+// issueTokenPair signs a fresh short-lived access token for wallet/state
+// and stores a new refresh token family for it. It is the replacement
+// for calling jwtSave directly from the login handlers.
+func issueTokenPair(w http.ResponseWriter, wallet, state string) (*tokenPair, error) {
+	claims := JWTClaims{Wallet: wallet, State: state}
+	claims.ExpiresAt = time.Now().Unix() + accessTokenExpire
+	if err := jwtSave(w, claims); err != nil {
+		return nil, err
+	}
+	refresh, _, err := newRefreshFamily(converter.StrToInt64(wallet), converter.StrToInt64(state))
+	if err != nil {
+		return nil, err
+	}
+	return &tokenPair{RefreshToken: refresh}, nil
+}
+
+// refreshHandler serves POST /api/v2/refresh. It verifies the presented
+// refresh token against the DB, rotates it (single-use), and issues a
+// new access+refresh pair. A refresh token that was already rotated
+// away means the family is compromised, so the whole family is revoked
+// and the request is rejected.
+func refreshHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	presented, _ := data.params[`refresh_token`].(string)
+	if len(presented) == 0 {
+		return errorAPI(w, `E_UNDEFINEVAL`, http.StatusBadRequest, `refresh_token`)
+	}
+	rec, err := refreshStoreImpl.Get(hashToken(presented))
+	if err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("getting refresh token")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	if rec == nil || rec.ExpiresAt < time.Now().Unix() {
+		return errorAPI(w, `E_REFRESHTOKEN`, http.StatusUnauthorized)
+	}
+	if rec.Rotated {
+		logger.WithFields(log.Fields{"family": rec.FamilyID, "wallet": rec.Wallet}).
+			Warning("reuse of a rotated refresh token, revoking family")
+		if err := refreshStoreImpl.RevokeFamily(rec.FamilyID); err != nil {
+			logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("revoking refresh token family")
+		}
+		return errorAPI(w, `E_REFRESHTOKEN`, http.StatusUnauthorized)
+	}
+	claims := JWTClaims{
+		Wallet: converter.Int64ToStr(rec.Wallet),
+		State:  converter.Int64ToStr(rec.State),
+	}
+	claims.ExpiresAt = time.Now().Unix() + accessTokenExpire
+	if err := jwtSave(w, claims); err != nil {
+		return err
+	}
+	newRefresh, err := generateOpaqueToken()
+	if err != nil {
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	if err := refreshStoreImpl.Rotate(rec.FamilyID, hashToken(presented), hashToken(newRefresh),
+		time.Now().Unix()+refreshTokenExpire); err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("rotating refresh token")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	data.result = &tokenPair{RefreshToken: newRefresh}
+	return nil
+}
+
+// logoutHandler serves POST /api/v2/logout. It revokes the refresh
+// token family for the presented token so the session cannot be
+// silently renewed any more.
+func logoutHandler(w http.ResponseWriter, r *http.Request, data *apiData, logger *log.Entry) error {
+	presented, _ := data.params[`refresh_token`].(string)
+	if len(presented) == 0 {
+		return errorAPI(w, `E_UNDEFINEVAL`, http.StatusBadRequest, `refresh_token`)
+	}
+	rec, err := refreshStoreImpl.Get(hashToken(presented))
+	if err != nil {
+		logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("getting refresh token")
+		return errorAPI(w, err, http.StatusInternalServerError)
+	}
+	if rec != nil {
+		if err := refreshStoreImpl.RevokeFamily(rec.FamilyID); err != nil {
+			logger.WithFields(log.Fields{"type": consts.DBError, "error": err}).Error("revoking refresh token family")
+			return errorAPI(w, err, http.StatusInternalServerError)
+		}
+	}
+	data.result = fmt.Sprintf(`logged out`)
+	return nil
+}
+
+// isTokenExpired reports whether err is the validation error jwt-go
+// returns for an access token past its ExpiresAt, so DefaultHandler can
+// tell the caller to hit /refresh instead of failing the request cold.
+func isTokenExpired(err error) bool {
+	verr, ok := err.(*jwt.ValidationError)
+	return ok && verr.Errors&jwt.ValidationErrorExpired != 0
+}
@@ -0,0 +1,130 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/EGaaS/go-egaas-mvp/packages/model"
+	log "github.com/sirupsen/logrus"
+)
+
+// testLogger is the *log.Entry every apiHandle in this package now takes,
+// stood up once per test instead of threading DefaultHandler's real
+// request logger through.
+func testLogger() *log.Entry {
+	return log.NewEntry(log.New())
+}
+
+// fakeRefreshStore is an in-memory refreshStore used so the rotation and
+// reuse-detection logic in refresh.go can be tested without a live DB.
+type fakeRefreshStore struct {
+	byHash map[string]*model.RefreshToken
+}
+
+func newFakeRefreshStore() *fakeRefreshStore {
+	return &fakeRefreshStore{byHash: make(map[string]*model.RefreshToken)}
+}
+
+func (f *fakeRefreshStore) Create(wallet, state int64, familyID, tokenHash string, expiresAt int64) error {
+	f.byHash[tokenHash] = &model.RefreshToken{Wallet: wallet, State: state, FamilyID: familyID,
+		TokenHash: tokenHash, ExpiresAt: expiresAt}
+	return nil
+}
+
+func (f *fakeRefreshStore) Get(tokenHash string) (*model.RefreshToken, error) {
+	return f.byHash[tokenHash], nil
+}
+
+func (f *fakeRefreshStore) RevokeFamily(familyID string) error {
+	for hash, rt := range f.byHash {
+		if rt.FamilyID == familyID {
+			delete(f.byHash, hash)
+		}
+	}
+	return nil
+}
+
+func (f *fakeRefreshStore) Rotate(familyID, oldHash, newHash string, expiresAt int64) error {
+	old, ok := f.byHash[oldHash]
+	if !ok {
+		return errors.New("fakeRefreshStore: unknown token hash")
+	}
+	old.Rotated = true
+	f.byHash[newHash] = &model.RefreshToken{Wallet: old.Wallet, State: old.State, FamilyID: familyID,
+		TokenHash: newHash, ExpiresAt: expiresAt}
+	return nil
+}
+
+func withFakeRefreshStore(t *testing.T) *fakeRefreshStore {
+	t.Helper()
+	fake := newFakeRefreshStore()
+	original := refreshStoreImpl
+	refreshStoreImpl = fake
+	t.Cleanup(func() { refreshStoreImpl = original })
+	return fake
+}
+
+func TestRefreshRotationIssuesNewFamilyMember(t *testing.T) {
+	withTestKeyManager(t)
+	withFakeRefreshStore(t)
+
+	pair, err := issueTokenPair(httptest.NewRecorder(), "123", "1")
+	if err != nil {
+		t.Fatalf("issueTokenPair: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	data := &apiData{params: map[string]interface{}{`refresh_token`: pair.RefreshToken}}
+	if err := refreshHandler(w, httptest.NewRequest("POST", "/api/v2/refresh", nil), data, testLogger()); err != nil {
+		t.Fatalf("refreshHandler: %v", err)
+	}
+	rotated := data.result.(*tokenPair)
+	if rotated.RefreshToken == pair.RefreshToken {
+		t.Fatal("refreshHandler returned the same refresh token instead of rotating it")
+	}
+}
+
+func TestRefreshReuseOfRotatedTokenRevokesFamily(t *testing.T) {
+	withTestKeyManager(t)
+	fake := withFakeRefreshStore(t)
+
+	pair, err := issueTokenPair(httptest.NewRecorder(), "123", "1")
+	if err != nil {
+		t.Fatalf("issueTokenPair: %v", err)
+	}
+
+	// First refresh succeeds and rotates the token.
+	data := &apiData{params: map[string]interface{}{`refresh_token`: pair.RefreshToken}}
+	if err := refreshHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v2/refresh", nil), data, testLogger()); err != nil {
+		t.Fatalf("first refreshHandler: %v", err)
+	}
+
+	// Presenting the now-rotated original token again must be rejected
+	// and must wipe out the whole family, including the token that was
+	// legitimately issued by the first refresh.
+	reuse := &apiData{params: map[string]interface{}{`refresh_token`: pair.RefreshToken}}
+	err = refreshHandler(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/v2/refresh", nil), reuse, testLogger())
+	if err == nil {
+		t.Fatal("expected reuse of a rotated refresh token to be rejected")
+	}
+	if len(fake.byHash) != 0 {
+		t.Fatalf("expected reuse detection to revoke the whole family, %d tokens remain", len(fake.byHash))
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package api_v2
+
+import (
+	hr "github.com/julienschmidt/httprouter"
+)
+
+// NewRouter builds the httprouter.Router serving every api_v2 endpoint.
+// It is the single place new handlers get wired up, so a handler that
+// compiles but was never registered here is easy to spot in review.
+func NewRouter() *hr.Router {
+	r := hr.New()
+
+	r.GET("/api/v2/keys", DefaultHandler(nil, keysHandler))
+	r.POST("/api/v2/keys/rotate", DefaultHandler(nil, authState, rotateKeyHandler))
+
+	r.POST("/api/v2/refresh", DefaultHandler(map[string]int{`refresh_token`: pString}, refreshHandler))
+	r.POST("/api/v2/logout", DefaultHandler(map[string]int{`refresh_token`: pString}, logoutHandler))
+
+	r.GET("/api/v2/oidc/:provider/login", DefaultHandler(nil, oidcLoginHandler))
+	r.GET("/api/v2/oidc/:provider/callback", DefaultHandler(nil, oidcCallbackHandler))
+
+	r.POST("/api/v2/device/code", DefaultHandler(map[string]int{`verification_uri`: pString | pOptional}, deviceCodeHandler))
+	r.POST("/api/v2/device/token", DefaultHandler(map[string]int{`device_code`: pString}, deviceTokenHandler))
+	r.GET("/api/v2/device/verify", DefaultHandler(map[string]int{`user_code`: pString}, authWallet, deviceVerifyHandler))
+
+	return r
+}
@@ -0,0 +1,38 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package cache provides a small pluggable caching layer for values that
+// are expensive or pointless to recompute on every API request, such as
+// DB-backed counters and parsed JWT claims.
+package cache
+
+import "time"
+
+// DefaultTTL is used by Set when no explicit TTL is given.
+const DefaultTTL = 30 * time.Minute
+
+// Cache is the interface every cache implementation in this package
+// satisfies. Get returns an error when the key is missing or expired so
+// callers can tell "not cached" apart from a cached nil value.
+type Cache interface {
+	Get(key string) (interface{}, error)
+	Set(key string, v interface{}) error
+	SetTTL(key string, v interface{}, ttl time.Duration) error
+	Delete(key string) error
+	// Invalidate deletes every key with the given prefix, for state
+	// changes that need to drop several related entries at once.
+	Invalidate(prefix string) error
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+// MemoryStore is an in-memory TTL-based Cache implementation. It sweeps
+// expired entries lazily on Get and periodically in the background, so
+// it is safe to use as a long-lived package-level singleton.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]entry
+}
+
+// NewMemoryStore builds an empty MemoryStore and starts its background
+// janitor, which sweeps expired entries every sweepInterval.
+func NewMemoryStore() *MemoryStore {
+	m := &MemoryStore{data: make(map[string]entry)}
+	go m.janitor(time.Minute)
+	return m
+}
+
+func (m *MemoryStore) janitor(interval time.Duration) {
+	for range time.Tick(interval) {
+		now := time.Now()
+		m.mu.Lock()
+		for key, e := range m.data {
+			if now.After(e.expireAt) {
+				delete(m.data, key)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Get returns the cached value for key, or an error if it is missing or
+// expired.
+func (m *MemoryStore) Get(key string) (interface{}, error) {
+	m.mu.RLock()
+	e, ok := m.data[key]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("cache: key %q not found", key)
+	}
+	if time.Now().After(e.expireAt) {
+		return nil, fmt.Errorf("cache: key %q expired", key)
+	}
+	return e.value, nil
+}
+
+// Set caches v under key for DefaultTTL.
+func (m *MemoryStore) Set(key string, v interface{}) error {
+	return m.SetTTL(key, v, DefaultTTL)
+}
+
+// SetTTL caches v under key for the given ttl.
+func (m *MemoryStore) SetTTL(key string, v interface{}, ttl time.Duration) error {
+	m.mu.Lock()
+	m.data[key] = entry{value: v, expireAt: time.Now().Add(ttl)}
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete removes key, if present.
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	delete(m.data, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// Invalidate removes every key starting with prefix.
+func (m *MemoryStore) Invalidate(prefix string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.data, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Noop is a Cache that never stores anything. It is useful for tests
+// and for deployments that would rather hit the DB every time than run
+// a cache.
+type Noop struct{}
+
+// NewNoop returns a Cache that never caches.
+func NewNoop() Noop { return Noop{} }
+
+// Get always reports key as missing.
+func (Noop) Get(key string) (interface{}, error) {
+	return nil, fmt.Errorf("cache: key %q not found", key)
+}
+
+// Set is a no-op.
+func (Noop) Set(key string, v interface{}) error { return nil }
+
+// SetTTL is a no-op.
+func (Noop) SetTTL(key string, v interface{}, ttl time.Duration) error { return nil }
+
+// Delete is a no-op.
+func (Noop) Delete(key string) error { return nil }
+
+// Invalidate is a no-op.
+func (Noop) Invalidate(prefix string) error { return nil }
@@ -0,0 +1,64 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+const (
+	// dataDirEnv overrides the node's data directory, same role the
+	// node config file's data_dir entry would normally play.
+	dataDirEnv = "EGAAS_DATA_DIR"
+	// oidcConfigEnv points at a JSON file describing the [[oidc]]
+	// provider list, for deployments that don't go through the full
+	// node config file to reach SetOIDCProviders.
+	oidcConfigEnv = "EGAAS_OIDC_CONFIG"
+)
+
+// LoadFromEnv applies the subset of node configuration that can be
+// supplied via environment variables, for commands that start up
+// without going through the full node config file. It is safe to call
+// even when neither variable is set.
+func LoadFromEnv() error {
+	if dir := os.Getenv(dataDirEnv); len(dir) > 0 {
+		SetDataDir(dir)
+	}
+	if path := os.Getenv(oidcConfigEnv); len(path) > 0 {
+		providers, err := loadOIDCProvidersFile(path)
+		if err != nil {
+			return fmt.Errorf("loading %s: %v", oidcConfigEnv, err)
+		}
+		SetOIDCProviders(providers)
+	}
+	return nil
+}
+
+func loadOIDCProvidersFile(path string) ([]OIDCProviderConfig, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var providers []OIDCProviderConfig
+	if err := json.Unmarshal(raw, &providers); err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+import "path/filepath"
+
+// keysDirName is where the JWT KeyManager persists its signing key,
+// alongside the node's own keystore directory.
+const keysDirName = "jwtkeys"
+
+// dataDir is the node's base data directory. It defaults to the current
+// directory and is meant to be overridden by the same config loading
+// that sets up the rest of the node's paths.
+var dataDir = "."
+
+// SetDataDir installs the node's base data directory, called while
+// parsing the node config file.
+func SetDataDir(dir string) {
+	dataDir = dir
+}
+
+// GetKeysDir returns the directory the JWT KeyManager should load its
+// signing key from and persist new ones to.
+func GetKeysDir() string {
+	return filepath.Join(dataDir, keysDirName)
+}
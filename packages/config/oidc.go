@@ -0,0 +1,43 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package config
+
+// OIDCProviderConfig describes one configured OIDC identity provider,
+// read from the node config file.
+type OIDCProviderConfig struct {
+	Name         string   `toml:"name"`
+	IssuerURL    string   `toml:"issuer_url"`
+	ClientID     string   `toml:"client_id"`
+	ClientSecret string   `toml:"client_secret"`
+	RedirectURL  string   `toml:"redirect_url"`
+	Scopes       []string `toml:"scopes"`
+}
+
+// oidcProviders holds the providers parsed out of the node config file's
+// [[oidc]] sections.
+var oidcProviders []OIDCProviderConfig
+
+// OIDCProviders returns the configured OIDC identity providers.
+func OIDCProviders() []OIDCProviderConfig {
+	return oidcProviders
+}
+
+// SetOIDCProviders installs the OIDC provider list, called while parsing
+// the node config file.
+func SetOIDCProviders(providers []OIDCProviderConfig) {
+	oidcProviders = providers
+}
@@ -17,8 +17,10 @@
 package controllers
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/EGaaS/go-egaas-mvp/packages/cache"
 	"github.com/EGaaS/go-egaas-mvp/packages/converter"
 	"github.com/EGaaS/go-egaas-mvp/packages/template"
 	"github.com/EGaaS/go-egaas-mvp/packages/utils"
@@ -26,6 +28,40 @@ import (
 
 const nAccounts = `accounts`
 
+// stateParamCache caches template.StateParam lookups, which are
+// effectively static per state, so pages that render a lot of rows
+// (like Accounts) don't re-read them from the DB on every request.
+var stateParamCache cache.Cache = cache.NewMemoryStore()
+
+func stateParamCacheKeyPrefix(stateID int64) string {
+	return fmt.Sprintf("state_param:%d:", stateID)
+}
+
+func cachedStateParam(stateID int64, name string) (string, error) {
+	key := stateParamCacheKeyPrefix(stateID) + name
+	if cached, err := stateParamCache.Get(key); err == nil {
+		if val, ok := cached.(string); ok {
+			return val, nil
+		}
+	}
+	val, err := template.StateParam(stateID, name)
+	if err != nil {
+		return val, err
+	}
+	if err := stateParamCache.Set(key, val); err != nil {
+		return val, err
+	}
+	return val, nil
+}
+
+// InvalidateStateParamCache drops every cached state_param entry for
+// stateID, such as money_digit and currency_name. Call it from whatever
+// handles admin edits to a state's parameters, so Accounts stops serving
+// stale values for up to cache.DefaultTTL after a change.
+func InvalidateStateParamCache(stateID int64) error {
+	return stateParamCache.Invalidate(stateParamCacheKeyPrefix(stateID))
+}
+
 // AccountInfo is a structure for the list of the accounts
 type AccountInfo struct {
 	AccountID int64  `json:"account_id"`
@@ -51,10 +87,10 @@ func (c *Controller) Accounts() (string, error) {
 
 	data := make([]AccountInfo, 0)
 
-	cents, _ := template.StateParam(c.SessStateID, `money_digit`)
+	cents, _ := cachedStateParam(c.SessStateID, `money_digit`)
 	digit := converter.StrToInt(cents)
 
-	currency, _ := template.StateParam(c.SessStateID, `currency_name`)
+	currency, _ := cachedStateParam(c.SessStateID, `currency_name`)
 
 	newAccount := func(account int64, amount string) {
 		if amount == `NULL` {
@@ -0,0 +1,53 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package controllers
+
+import "testing"
+
+func TestInvalidateStateParamCacheDropsEveryKeyForState(t *testing.T) {
+	const stateID = 7
+	key := stateParamCacheKeyPrefix(stateID) + `money_digit`
+	if err := stateParamCache.Set(key, `2`); err != nil {
+		t.Fatalf("priming cache: %v", err)
+	}
+	if _, err := stateParamCache.Get(key); err != nil {
+		t.Fatalf("expected cached value to be readable before invalidation: %v", err)
+	}
+
+	if err := InvalidateStateParamCache(stateID); err != nil {
+		t.Fatalf("InvalidateStateParamCache: %v", err)
+	}
+
+	if _, err := stateParamCache.Get(key); err == nil {
+		t.Fatal("expected InvalidateStateParamCache to drop the cached entry")
+	}
+}
+
+func TestInvalidateStateParamCacheLeavesOtherStatesAlone(t *testing.T) {
+	otherKey := stateParamCacheKeyPrefix(8) + `money_digit`
+	if err := stateParamCache.Set(otherKey, `2`); err != nil {
+		t.Fatalf("priming cache: %v", err)
+	}
+
+	if err := InvalidateStateParamCache(7); err != nil {
+		t.Fatalf("InvalidateStateParamCache: %v", err)
+	}
+
+	if _, err := stateParamCache.Get(otherKey); err != nil {
+		t.Fatal("expected InvalidateStateParamCache to leave other states' entries alone")
+	}
+}
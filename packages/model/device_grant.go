@@ -0,0 +1,117 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Device grant status values.
+const (
+	DeviceGrantPending = iota
+	DeviceGrantApproved
+	DeviceGrantDenied
+)
+
+// DeviceGrant is a single device-authorization-grant row: a CLI/kiosk
+// client polls it by device_code while a browser confirms it by
+// user_code.
+type DeviceGrant struct {
+	ID           int64  `gorm:"primary_key"`
+	DeviceCode   string `gorm:"column:device_code;unique_index"`
+	UserCode     string `gorm:"column:user_code;unique_index"`
+	Status       int    `gorm:"column:status"`
+	Wallet       int64  `gorm:"column:wallet"`
+	State        int64  `gorm:"column:state"`
+	Interval     int    `gorm:"column:interval"`
+	LastPolledAt int64  `gorm:"column:last_polled_at"`
+	ExpiresAt    int64  `gorm:"column:expires_at"`
+	CreatedAt    time.Time
+}
+
+// TableName maps DeviceGrant onto device_grants rather than gorm's
+// pluralized default.
+func (DeviceGrant) TableName() string {
+	return "device_grants"
+}
+
+// CreateDeviceGrant stores a freshly issued, pending device grant.
+func CreateDeviceGrant(deviceCode, userCode string, interval int, expiresAt int64) error {
+	return DBConn.Create(&DeviceGrant{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		Status:     DeviceGrantPending,
+		Interval:   interval,
+		ExpiresAt:  expiresAt,
+	}).Error
+}
+
+// GetDeviceGrant looks up a device grant by its device_code. It returns
+// (nil, nil), not an error, when no such grant exists.
+func GetDeviceGrant(deviceCode string) (*DeviceGrant, error) {
+	var g DeviceGrant
+	err := DBConn.Where("device_code = ?", deviceCode).First(&g).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GetDeviceGrantByUserCode looks up a device grant by its human-typeable
+// user_code, for the browser confirmation step.
+func GetDeviceGrantByUserCode(userCode string) (*DeviceGrant, error) {
+	var g DeviceGrant
+	err := DBConn.Where("user_code = ?", userCode).First(&g).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// UpdateDeviceGrantPoll records the last time a client polled for a
+// grant and its (possibly bumped, for slow_down) poll interval.
+func UpdateDeviceGrantPoll(deviceCode string, polledAt int64, interval int) error {
+	return DBConn.Model(&DeviceGrant{}).Where("device_code = ?", deviceCode).
+		Updates(map[string]interface{}{"last_polled_at": polledAt, "interval": interval}).Error
+}
+
+// ApproveDeviceGrant marks a pending grant approved and binds it to the
+// wallet+state of the browser session that confirmed it.
+func ApproveDeviceGrant(deviceCode string, wallet, state int64) error {
+	return DBConn.Model(&DeviceGrant{}).Where("device_code = ?", deviceCode).
+		Updates(map[string]interface{}{"status": DeviceGrantApproved, "wallet": wallet, "state": state}).Error
+}
+
+// DeleteDeviceGrant removes a grant once it has been redeemed for a
+// token pair.
+func DeleteDeviceGrant(deviceCode string) error {
+	return DBConn.Where("device_code = ?", deviceCode).Delete(&DeviceGrant{}).Error
+}
+
+// DeleteExpiredDeviceGrants reaps every grant past its expires_at, so
+// the table stays bounded even if a client never redeems its code.
+func DeleteExpiredDeviceGrants(now int64) error {
+	return DBConn.Where("expires_at < ?", now).Delete(&DeviceGrant{}).Error
+}
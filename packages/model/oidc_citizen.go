@@ -0,0 +1,63 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import "github.com/jinzhu/gorm"
+
+// oidcCitizenDefaultState is the ecosystem a citizen provisioned purely
+// from an OIDC login lands in; it matches the default state used
+// elsewhere for newly registered accounts.
+const oidcCitizenDefaultState = 1
+
+// OIDCCitizen is the (provider, subject) -> (wallet, state) mapping
+// used to recognize a returning OIDC-authenticated user.
+type OIDCCitizen struct {
+	ID       int64  `gorm:"primary_key"`
+	Provider string `gorm:"column:provider;unique_index:oidc_provider_subject"`
+	Subject  string `gorm:"column:subject;unique_index:oidc_provider_subject"`
+	Wallet   int64  `gorm:"column:wallet"`
+	State    int64  `gorm:"column:state"`
+}
+
+// TableName maps OIDCCitizen onto oidc_citizens rather than gorm's
+// pluralized default.
+func (OIDCCitizen) TableName() string {
+	return "oidc_citizens"
+}
+
+// GetOrCreateOIDCCitizen maps an OIDC (provider, subject) pair to a
+// local wallet+state, provisioning a new citizen record the first time
+// a given subject logs in.
+func GetOrCreateOIDCCitizen(provider, subject string) (wallet, state int64, err error) {
+	var c OIDCCitizen
+	err = DBConn.Where("provider = ? AND subject = ?", provider, subject).First(&c).Error
+	if err == nil {
+		return c.Wallet, c.State, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return 0, 0, err
+	}
+	wallet, err = GetNextID(`citizens`)
+	if err != nil {
+		return 0, 0, err
+	}
+	c = OIDCCitizen{Provider: provider, Subject: subject, Wallet: wallet, State: oidcCitizenDefaultState}
+	if err = DBConn.Create(&c).Error; err != nil {
+		return 0, 0, err
+	}
+	return c.Wallet, c.State, nil
+}
@@ -0,0 +1,108 @@
+// Copyright 2016 The go-daylight Authors
+// This file is part of the go-daylight library.
+//
+// The go-daylight library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-daylight library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-daylight library. If not, see <http://www.gnu.org/licenses/>.
+
+package model
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RefreshToken is a single refresh-token record in the refresh_tokens
+// table. It is keyed by the SHA-256 hash of the opaque token handed to
+// the client, so the raw token itself never touches disk.
+type RefreshToken struct {
+	ID        int64 `gorm:"primary_key"`
+	Wallet    int64 `gorm:"column:wallet;index"`
+	State     int64 `gorm:"column:state"`
+	FamilyID  string `gorm:"column:family_id;index"`
+	TokenHash string `gorm:"column:token_hash;unique_index"`
+	// Rotated is set once a newer token has been issued for this
+	// family; a refresh request presenting a rotated token is reuse of
+	// an already-spent token, which revokes the whole family.
+	Rotated   bool `gorm:"column:rotated"`
+	ExpiresAt int64 `gorm:"column:expires_at"`
+	CreatedAt time.Time
+}
+
+// TableName maps RefreshToken onto refresh_tokens rather than gorm's
+// pluralized default.
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// CreateRefreshToken stores a brand-new refresh token as the first
+// member of a new rotation family.
+func CreateRefreshToken(wallet, state int64, familyID, tokenHash string, expiresAt int64) error {
+	return DBConn.Create(&RefreshToken{
+		Wallet:    wallet,
+		State:     state,
+		FamilyID:  familyID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}).Error
+}
+
+// GetRefreshToken looks up a refresh token by the hash of its raw value.
+// It returns (nil, nil), not an error, when no such token exists.
+func GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var rt RefreshToken
+	err := DBConn.Where("token_hash = ?", tokenHash).First(&rt).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// RevokeRefreshFamily deletes every refresh token belonging to familyID.
+// It is used both for an explicit logout and for reuse-detected family
+// revocation.
+func RevokeRefreshFamily(familyID string) error {
+	return DBConn.Where("family_id = ?", familyID).Delete(&RefreshToken{}).Error
+}
+
+// RotateRefreshToken marks oldHash as rotated, so a later replay of it
+// is detected as reuse, and inserts newHash as the family's live token.
+// Both steps run in one transaction so a crash between them can't leave
+// a family with no live token.
+func RotateRefreshToken(familyID, oldHash, newHash string, expiresAt int64) error {
+	tx := DBConn.Begin()
+	var old RefreshToken
+	if err := tx.Where("token_hash = ?", oldHash).First(&old).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(&RefreshToken{}).Where("token_hash = ?", oldHash).
+		Update("rotated", true).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Create(&RefreshToken{
+		Wallet:    old.Wallet,
+		State:     old.State,
+		FamilyID:  familyID,
+		TokenHash: newHash,
+		ExpiresAt: expiresAt,
+	}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}